@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig mirrors the connection-limit subset of config that can be
+// set via -config, so operators can check these knobs into version
+// control instead of a long flag invocation. Any flag passed explicitly
+// on the command line always wins over the value in the file.
+type fileConfig struct {
+	ReadHeaderTimeout *time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       *time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      *time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       *time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    *int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	MaxConns          *int           `yaml:"max_conns" toml:"max_conns"`
+	ShutdownTimeout   *time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// loadFileConfig reads and parses a YAML or TOML config file, chosen by
+// the file's extension.
+func loadFileConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &fileConfig{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, fc); err != nil {
+			return nil, fmt.Errorf("parse YAML: %w", err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), fc); err != nil {
+			return nil, fmt.Errorf("parse TOML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (want .yaml, .yml, or .toml)", ext)
+	}
+
+	return fc, nil
+}
+
+// applyTo copies fields set in fc into cfg, skipping any flag name
+// present in explicit (as populated by flag.Visit after flag.Parse).
+func (fc *fileConfig) applyTo(cfg *config, explicit map[string]bool) {
+	if fc.ReadHeaderTimeout != nil && !explicit["read-header-timeout"] {
+		cfg.readHeaderTimeout = *fc.ReadHeaderTimeout
+	}
+	if fc.ReadTimeout != nil && !explicit["read-timeout"] {
+		cfg.readTimeout = *fc.ReadTimeout
+	}
+	if fc.WriteTimeout != nil && !explicit["write-timeout"] {
+		cfg.writeTimeout = *fc.WriteTimeout
+	}
+	if fc.IdleTimeout != nil && !explicit["idle-timeout"] {
+		cfg.idleTimeout = *fc.IdleTimeout
+	}
+	if fc.MaxHeaderBytes != nil && !explicit["max-header-bytes"] {
+		cfg.maxHeaderBytes = *fc.MaxHeaderBytes
+	}
+	if fc.MaxConns != nil && !explicit["max-conns"] {
+		cfg.maxConns = *fc.MaxConns
+	}
+	if fc.ShutdownTimeout != nil && !explicit["shutdown-timeout"] {
+		cfg.shutdownTimeout = *fc.ShutdownTimeout
+	}
+}
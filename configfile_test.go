@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileConfigApplyTo(t *testing.T) {
+	readHeaderTimeout := 7 * time.Second
+	maxConns := 42
+
+	fc := &fileConfig{
+		ReadHeaderTimeout: &readHeaderTimeout,
+		MaxConns:          &maxConns,
+	}
+
+	t.Run("file value applies when flag not set explicitly", func(t *testing.T) {
+		cfg := &config{readHeaderTimeout: time.Second, maxConns: 1}
+		fc.applyTo(cfg, map[string]bool{})
+
+		if cfg.readHeaderTimeout != readHeaderTimeout {
+			t.Errorf("readHeaderTimeout = %v, want %v", cfg.readHeaderTimeout, readHeaderTimeout)
+		}
+		if cfg.maxConns != maxConns {
+			t.Errorf("maxConns = %v, want %v", cfg.maxConns, maxConns)
+		}
+	})
+
+	t.Run("explicit flag wins over file value", func(t *testing.T) {
+		cfg := &config{readHeaderTimeout: time.Second, maxConns: 1}
+		fc.applyTo(cfg, map[string]bool{"read-header-timeout": true, "max-conns": true})
+
+		if cfg.readHeaderTimeout != time.Second {
+			t.Errorf("readHeaderTimeout = %v, want unchanged %v", cfg.readHeaderTimeout, time.Second)
+		}
+		if cfg.maxConns != 1 {
+			t.Errorf("maxConns = %v, want unchanged %v", cfg.maxConns, 1)
+		}
+	})
+
+	t.Run("unset file fields leave config untouched", func(t *testing.T) {
+		cfg := &config{writeTimeout: 3 * time.Second, shutdownTimeout: 9 * time.Second}
+		(&fileConfig{}).applyTo(cfg, map[string]bool{})
+
+		if cfg.writeTimeout != 3*time.Second {
+			t.Errorf("writeTimeout = %v, want unchanged %v", cfg.writeTimeout, 3*time.Second)
+		}
+		if cfg.shutdownTimeout != 9*time.Second {
+			t.Errorf("shutdownTimeout = %v, want unchanged %v", cfg.shutdownTimeout, 9*time.Second)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// readiness tracks whether the service is ready to receive traffic, as
+// reported by the /readyz endpoint and the sd_notify READY/STOPPING
+// states. It starts not-ready and flips once all listeners are up.
+type readiness struct {
+	ready atomic.Bool
+}
+
+func (r *readiness) set(v bool) { r.ready.Store(v) }
+func (r *readiness) get() bool  { return r.ready.Load() }
+
+// newMux builds the application handler: the public handler plus the
+// built-in introspection endpoints (/healthz, /readyz, /metrics,
+// /debug/pprof/*). When adminMux is non-nil, the introspection
+// endpoints are mounted there instead, so they can be served from a
+// separate, private listener rather than alongside public traffic.
+func newMux(handler http.Handler, ready *readiness, adminMux *http.ServeMux) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	introspect := mux
+	if adminMux != nil {
+		introspect = adminMux
+	}
+
+	introspect.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	introspect.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready.get() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	introspect.Handle("/metrics", promhttp.Handler())
+	introspect.HandleFunc("/debug/pprof/", pprof.Index)
+	introspect.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	introspect.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	introspect.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	introspect.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
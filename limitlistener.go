@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// limitListener wraps a net.Listener to report per-listener accept and
+// active-connection counts via metrics, and, when maxConns is positive,
+// blocks Accept once that many connections are active so a single
+// listener can't exhaust server resources.
+type limitListener struct {
+	net.Listener
+	sem     chan struct{}
+	metrics *listenerMetrics
+}
+
+func newLimitListener(l net.Listener, maxConns int, metrics *listenerMetrics) net.Listener {
+	ll := &limitListener{Listener: l, metrics: metrics}
+	if maxConns > 0 {
+		ll.sem = make(chan struct{}, maxConns)
+	}
+	return ll
+}
+
+// File delegates to the wrapped listener's File method, if any, so that
+// a limitListener still satisfies the filer interface reload.go uses to
+// extract fds for a SIGHUP re-exec.
+func (l *limitListener) File() (*os.File, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+	f, ok := l.Listener.(filer)
+	if !ok {
+		return nil, fmt.Errorf("listener %s does not support file extraction", l.Addr())
+	}
+	return f.File()
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.sem != nil {
+		l.sem <- struct{}{}
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		if l.sem != nil {
+			<-l.sem
+		}
+		return nil, err
+	}
+
+	l.metrics.accepted.Inc()
+	l.metrics.active.Inc()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.metrics.active.Dec()
+			if l.sem != nil {
+				<-l.sem
+			}
+		})
+	}
+	return &limitConn{Conn: c, release: release}, nil
+}
+
+// limitConn releases its listener's semaphore slot and active-count
+// the first time it is closed; http.Server may call Close more than
+// once during shutdown, so the release must be idempotent.
+type limitConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	defer c.release()
+	return c.Conn.Close()
+}
+
+// RawConn returns the conn limitConn wraps, so callers that need the
+// concrete conn type underneath (e.g. connContext looking for a
+// *net.UnixConn to read SO_PEERCRED from) can unwrap past it.
+func (c *limitConn) RawConn() net.Conn { return c.Conn }
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/fcgi"
 	"net/url"
 	"os"
 	"os/signal"
@@ -14,6 +16,10 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type addrs []string
@@ -21,41 +27,155 @@ type addrs []string
 func (a *addrs) String() string     { return "" }
 func (a *addrs) Set(v string) error { *a = append(*a, v); return nil }
 
-func parseListenAddr(addr string) (network, address string, err error) {
+// listenSpec describes how to listen on and serve a single -listen
+// address, as parsed from its URL scheme.
+type listenSpec struct {
+	network string
+	address string
+	tls     bool // tls:// or https://: wrap the listener in tls.NewListener
+	h2c     bool // h2c://: serve cleartext HTTP/2
+	fcgi    bool // fcgi://: serve FastCGI instead of HTTP
+	proxy   bool // proxy+tcp:// or proxy+unix://: expect a PROXY protocol header
+
+	unixMode *os.FileMode // unix:// ?mode=0660
+	unixUID  *int         // unix:// ?uid=
+	unixGID  *int         // unix:// ?gid=
+}
+
+// name is how this listener's scheme is recorded in LISTEN_FDNAMES
+// across a SIGHUP re-exec, so the child can restore fcgi/proxy mode for
+// listeners that were never associated with an on-disk systemd socket
+// unit. Plain HTTP listeners use the default name.
+func (s listenSpec) name() string {
+	switch {
+	case s.fcgi:
+		return "fcgi:" + s.address
+	case s.proxy:
+		return "proxy:" + s.address
+	default:
+		return ""
+	}
+}
+
+func parseListenAddr(addr string) (listenSpec, error) {
 	u, err := url.Parse(addr)
 	if err != nil {
-		return "", "", fmt.Errorf("invalid address format: %w", err)
+		return listenSpec{}, fmt.Errorf("invalid address format: %w", err)
 	}
 
 	switch u.Scheme {
 	case "unix":
-		path := u.Path
-		if u.Host != "" {
-			path = u.Host + path
-		}
-		if path == "" {
-			return "", "", fmt.Errorf("unix socket path cannot be empty")
+		return parseUnixListenAddr(u)
+	case "proxy+unix":
+		spec, err := parseUnixListenAddr(u)
+		if err != nil {
+			return listenSpec{}, err
 		}
-		return "unix", path, nil
-	case "":
-		return "tcp", addr, nil
+		spec.proxy = true
+		return spec, nil
+	case "", "tcp":
+		return listenSpec{network: "tcp", address: u.Host + u.Path}, nil
+	case "tls", "https":
+		return listenSpec{network: "tcp", address: u.Host, tls: true}, nil
+	case "h2c":
+		return listenSpec{network: "tcp", address: u.Host, h2c: true}, nil
+	case "fcgi":
+		return listenSpec{network: "tcp", address: u.Host, fcgi: true}, nil
+	case "proxy+tcp":
+		return listenSpec{network: "tcp", address: u.Host, proxy: true}, nil
 	default:
-		return "", "", fmt.Errorf("unsupported scheme %q (supported: unix)", u.Scheme)
+		return listenSpec{}, fmt.Errorf("unsupported scheme %q (supported: unix, tcp, tls, https, h2c, fcgi, proxy+tcp, proxy+unix)", u.Scheme)
 	}
 }
 
+func parseUnixListenAddr(u *url.URL) (listenSpec, error) {
+	path := u.Path
+	if u.Host != "" {
+		path = u.Host + path
+	}
+	if path == "" {
+		return listenSpec{}, fmt.Errorf("unix socket path cannot be empty")
+	}
+
+	spec := listenSpec{network: "unix", address: path}
+	q := u.Query()
+	if mode := q.Get("mode"); mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return listenSpec{}, fmt.Errorf("invalid mode %q: %w", mode, err)
+		}
+		fm := os.FileMode(m)
+		spec.unixMode = &fm
+	}
+	if uid := q.Get("uid"); uid != "" {
+		n, err := strconv.Atoi(uid)
+		if err != nil {
+			return listenSpec{}, fmt.Errorf("invalid uid %q: %w", uid, err)
+		}
+		spec.unixUID = &n
+	}
+	if gid := q.Get("gid"); gid != "" {
+		n, err := strconv.Atoi(gid)
+		if err != nil {
+			return listenSpec{}, fmt.Errorf("invalid gid %q: %w", gid, err)
+		}
+		spec.unixGID = &n
+	}
+	return spec, nil
+}
+
 type config struct {
 	addresses     []string
+	adminAddress  string
 	listenPid     int
 	listenFds     int
 	listenFdnames []string
+
+	tlsCert       string
+	tlsKey        string
+	tlsClientCA   string
+	tlsMinVersion string
+
+	configPath string
+
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	maxConns          int
+	shutdownTimeout   time.Duration
 }
 
 func parseConfig() (*config, error) {
 	cfg := &config{}
-	flag.Var((*addrs)(&cfg.addresses), "listen", "address to listen on (TCP: :8080, 127.0.0.1:80; Unix: unix:///run/foo.sock)")
+	flag.Var((*addrs)(&cfg.addresses), "listen", "address to listen on (TCP: :8080, 127.0.0.1:80; Unix: unix:///run/foo.sock; TLS: tls://:8443; h2c: h2c://:8080)")
+	flag.StringVar(&cfg.adminAddress, "admin-listen", "", "address for admin endpoints (/healthz, /readyz, /metrics, /debug/pprof/*); served alongside public traffic when unset")
+	flag.StringVar(&cfg.tlsCert, "tls-cert", "", "PEM certificate file, required for tls:// and https:// listeners")
+	flag.StringVar(&cfg.tlsKey, "tls-key", "", "PEM private key file, required for tls:// and https:// listeners")
+	flag.StringVar(&cfg.tlsClientCA, "tls-client-ca", "", "PEM CA bundle used to require and verify client certificates")
+	flag.StringVar(&cfg.tlsMinVersion, "tls-min-version", "1.2", "minimum TLS version to accept (1.0, 1.1, 1.2, 1.3)")
+	flag.StringVar(&cfg.configPath, "config", "", "path to a YAML or TOML file providing defaults for the connection-limit flags below; explicit flags always win")
+	flag.DurationVar(&cfg.readHeaderTimeout, "read-header-timeout", 10*time.Second, "maximum duration to read request headers")
+	flag.DurationVar(&cfg.readTimeout, "read-timeout", 0, "maximum duration to read the full request, including the body (0 = no limit)")
+	flag.DurationVar(&cfg.writeTimeout, "write-timeout", 0, "maximum duration to write the response (0 = no limit)")
+	flag.DurationVar(&cfg.idleTimeout, "idle-timeout", 120*time.Second, "maximum time to wait for the next request on a keep-alive connection")
+	flag.IntVar(&cfg.maxHeaderBytes, "max-header-bytes", 0, "maximum size of request headers (0 = http.DefaultMaxHeaderBytes)")
+	flag.IntVar(&cfg.maxConns, "max-conns", 0, "maximum concurrent connections per listener (0 = unlimited)")
+	flag.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "how long to wait for in-flight requests to drain on shutdown or reload before forcibly closing connections")
 	flag.Parse()
 
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if cfg.configPath != "" {
+		fc, err := loadFileConfig(cfg.configPath)
+		if err != nil {
+			return nil, fmt.Errorf("load -config %s: %w", cfg.configPath, err)
+		}
+		fc.applyTo(cfg, explicit)
+	}
+
 	if pid := os.Getenv("LISTEN_PID"); pid != "" {
 		var err error
 		cfg.listenPid, err = strconv.Atoi(pid)
@@ -88,8 +208,17 @@ func parseConfig() (*config, error) {
 
 const listenFdsStart = 3
 
-func (c *config) listeners() ([]net.Listener, error) {
-	var listeners []net.Listener
+// boundListener pairs a ready-to-serve net.Listener with the front-end
+// mode it should be served with and the name it should be re-advertised
+// under in LISTEN_FDNAMES across a SIGHUP re-exec.
+type boundListener struct {
+	net.Listener
+	fcgi bool
+	name string
+}
+
+func (c *config) listeners() ([]boundListener, error) {
+	var listeners []boundListener
 	var err error
 
 	defer func() {
@@ -108,36 +237,124 @@ func (c *config) listeners() ([]net.Listener, error) {
 			if i < len(c.listenFdnames) && len(c.listenFdnames[i]) > 0 {
 				name = c.listenFdnames[i]
 			}
+			if strings.HasPrefix(name, "admin:") {
+				// Claimed by adoptAdminListener instead.
+				continue
+			}
 			f := os.NewFile(uintptr(fd), name)
-			if l, ferr := net.FileListener(f); ferr == nil {
-				listeners = append(listeners, l)
-				if ferr := f.Close(); ferr != nil {
-					err = fmt.Errorf("failed to close file %s: %w", f.Name(), ferr)
-					return nil, err
-				}
+			l, ferr := net.FileListener(f)
+			if ferr != nil {
+				continue
+			}
+			if ferr := f.Close(); ferr != nil {
+				err = fmt.Errorf("failed to close file %s: %w", f.Name(), ferr)
+				return nil, err
+			}
+
+			bl := boundListener{fcgi: false, name: name}
+			switch {
+			case strings.HasPrefix(name, "fcgi:"):
+				bl.fcgi = true
+			case strings.HasPrefix(name, "proxy:"):
+				l = newProxyListener(l)
 			}
+			bl.Listener = newLimitListener(l, c.maxConns, newListenerMetrics(l.Addr().String()))
+			listeners = append(listeners, bl)
 		}
 	}
 
 	for _, addr := range c.addresses {
-		network, address, parseErr := parseListenAddr(addr)
-		if parseErr != nil {
-			err = fmt.Errorf("invalid listen address %q: %w", addr, parseErr)
+		var spec listenSpec
+		spec, err = parseListenAddr(addr)
+		if err != nil {
+			err = fmt.Errorf("invalid listen address %q: %w", addr, err)
 			return nil, err
 		}
 
 		var l net.Listener
-		l, err = net.Listen(network, address)
+		l, err = net.Listen(spec.network, spec.address)
 		if err != nil {
-			err = fmt.Errorf("failed to listen on %s (%s): %w", addr, network, err)
+			err = fmt.Errorf("failed to listen on %s (%s): %w", addr, spec.network, err)
 			return nil, err
 		}
-		listeners = append(listeners, l)
+
+		if spec.network == "unix" {
+			if spec.unixMode != nil {
+				if cerr := os.Chmod(spec.address, *spec.unixMode); cerr != nil {
+					err = fmt.Errorf("chmod %s: %w", spec.address, cerr)
+					return nil, err
+				}
+			}
+			if spec.unixUID != nil || spec.unixGID != nil {
+				uid, gid := -1, -1
+				if spec.unixUID != nil {
+					uid = *spec.unixUID
+				}
+				if spec.unixGID != nil {
+					gid = *spec.unixGID
+				}
+				if cerr := os.Chown(spec.address, uid, gid); cerr != nil {
+					err = fmt.Errorf("chown %s: %w", spec.address, cerr)
+					return nil, err
+				}
+			}
+		}
+
+		l = newLimitListener(l, c.maxConns, newListenerMetrics(l.Addr().String()))
+
+		if spec.proxy {
+			l = newProxyListener(l)
+		}
+
+		if spec.tls {
+			var tlsCfg *tls.Config
+			tlsCfg, err = c.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			l = newTLSListener(l, tlsCfg)
+		}
+
+		listeners = append(listeners, boundListener{Listener: l, fcgi: spec.fcgi, name: spec.name()})
 	}
 
 	return listeners, nil
 }
 
+// adoptAdminListener looks for an inherited systemd socket-activation fd
+// named "admin:" (see listeners above), so a SIGHUP reload can hand the
+// admin listener's fd across execSelf the same way public listeners are
+// handed across, instead of always rebinding it fresh.
+func (c *config) adoptAdminListener() (net.Listener, bool, error) {
+	if c.listenPid == 0 || c.listenPid != os.Getpid() {
+		return nil, false, nil
+	}
+
+	for i := 0; i < c.listenFds; i++ {
+		fd := listenFdsStart + i
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(c.listenFdnames) && len(c.listenFdnames[i]) > 0 {
+			name = c.listenFdnames[i]
+		}
+		if !strings.HasPrefix(name, "admin:") {
+			continue
+		}
+
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		if err != nil {
+			continue
+		}
+		if err := f.Close(); err != nil {
+			return nil, false, fmt.Errorf("failed to close file %s: %w", f.Name(), err)
+		}
+		return l, true, nil
+	}
+
+	return nil, false, nil
+}
+
 func main() {
 	cfg, err := parseConfig()
 	if err != nil {
@@ -166,27 +383,186 @@ func main() {
 		os.Exit(1)
 	}
 
-	srv := &http.Server{Handler: handler}
+	ready := &readiness{}
+
+	var adminMux *http.ServeMux
+	var adminListener net.Listener
+	var adminName string
+	if cfg.adminAddress != "" {
+		spec, perr := parseListenAddr(cfg.adminAddress)
+		if perr != nil {
+			slog.Error("invalid admin-listen address", "error", perr)
+			os.Exit(1)
+		}
+		adminName = "admin:" + spec.address
+
+		adopted, ok, aerr := cfg.adoptAdminListener()
+		if aerr != nil {
+			slog.Error("failed to adopt inherited admin listener", "error", aerr)
+			os.Exit(1)
+		}
+		if ok {
+			adminListener = adopted
+		} else {
+			adminListener, err = net.Listen(spec.network, spec.address)
+			if err != nil {
+				slog.Error("failed to listen on admin address", "addr", cfg.adminAddress, "error", err)
+				os.Exit(1)
+			}
+		}
+		adminListener = newLimitListener(adminListener, cfg.maxConns, newListenerMetrics(adminListener.Addr().String()))
+		if spec.tls {
+			tlsCfg, terr := cfg.tlsConfig()
+			if terr != nil {
+				slog.Error("invalid TLS config for admin listener", "error", terr)
+				os.Exit(1)
+			}
+			adminListener = newTLSListener(adminListener, tlsCfg)
+		}
+		adminMux = http.NewServeMux()
+	}
+
+	// h2c.NewHandler transparently upgrades h1 connections that request
+	// cleartext HTTP/2 (and serves h2c prior-knowledge connections), so
+	// it is safe to wrap every listener's handler with it regardless of
+	// whether that particular -listen address used the h2c:// scheme.
+	mux := newMux(handler, ready, adminMux)
+	srv := &http.Server{
+		Handler:           h2c.NewHandler(mux, &http2.Server{}),
+		ConnContext:       connContext,
+		ReadHeaderTimeout: cfg.readHeaderTimeout,
+		ReadTimeout:       cfg.readTimeout,
+		WriteTimeout:      cfg.writeTimeout,
+		IdleTimeout:       cfg.idleTimeout,
+		MaxHeaderBytes:    cfg.maxHeaderBytes,
+	}
+	if err := http2.ConfigureServer(srv, &http2.Server{}); err != nil {
+		slog.Error("failed to configure HTTP/2", "error", err)
+		os.Exit(1)
+	}
+
+	var adminSrv *http.Server
+	if adminMux != nil {
+		adminSrv = &http.Server{
+			Handler:           h2c.NewHandler(adminMux, &http2.Server{}),
+			ConnContext:       connContext,
+			ReadHeaderTimeout: cfg.readHeaderTimeout,
+			ReadTimeout:       cfg.readTimeout,
+			WriteTimeout:      cfg.writeTimeout,
+			IdleTimeout:       cfg.idleTimeout,
+			MaxHeaderBytes:    cfg.maxHeaderBytes,
+		}
+	}
+
+	shutdownServer := func(srv *http.Server, name string) {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error(name+" shutdown failed, forcing close", "error", err)
+			if err := srv.Close(); err != nil {
+				slog.Error(name+" close failed", "error", err)
+			}
+		}
+	}
 
 	go func() {
 		<-ctx.Done()
-		if err := srv.Shutdown(context.Background()); err != nil {
-			slog.Error("shutdown failed", "error", err)
+		ready.set(false)
+		if err := sdNotify("STOPPING=1"); err != nil {
+			slog.Warn("sd_notify failed", "error", err)
+		}
+		shutdownServer(srv, "server")
+		if adminSrv != nil {
+			shutdownServer(adminSrv, "admin server")
+		}
+	}()
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+				slog.Info("reloading on SIGHUP")
+				reloadListeners := listeners
+				if adminListener != nil {
+					reloadListeners = append(append([]boundListener{}, listeners...), boundListener{Listener: adminListener, name: adminName})
+				}
+				n, err := reloadFDs(reloadListeners)
+				if err != nil {
+					slog.Error("reload: preparing listener fds failed", "error", err)
+					continue
+				}
+				names := make([]string, len(reloadListeners))
+				for i, l := range reloadListeners {
+					names[i] = l.name
+				}
+				shutdownServer(srv, "server")
+				if adminSrv != nil {
+					shutdownServer(adminSrv, "admin server")
+				}
+				if err := execSelf(n, names); err != nil {
+					slog.Error("reload: exec failed", "error", err)
+				}
+			}
 		}
 	}()
 
+	if interval, ok := watchdogInterval(); ok {
+		go func() {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					if err := sdNotify("WATCHDOG=1"); err != nil {
+						slog.Warn("watchdog notify failed", "error", err)
+					}
+				}
+			}
+		}()
+	}
+
 	var wg sync.WaitGroup
 	for _, l := range listeners {
-		slog.Info("listener", "addr", l.Addr().String())
+		slog.Info("listener", "addr", l.Addr().String(), "fcgi", l.fcgi)
 		wg.Add(1)
-		go func(listener net.Listener) {
+		go func(bl boundListener) {
 			defer wg.Done()
-			if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
-				slog.Error("server stopped", "addr", listener.Addr().String(), "error", err)
+			var err error
+			if bl.fcgi {
+				err = fcgi.Serve(bl.Listener, mux)
+			} else {
+				err = srv.Serve(bl.Listener)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				slog.Error("server stopped", "addr", bl.Addr().String(), "error", err)
 			}
 		}(l)
 	}
 
+	if adminListener != nil {
+		slog.Info("admin listener", "addr", adminListener.Addr().String())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := adminSrv.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				slog.Error("admin server stopped", "addr", adminListener.Addr().String(), "error", err)
+			}
+		}()
+	}
+
+	ready.set(true)
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("sd_notify failed", "error", err)
+	}
+
 	<-ctx.Done()
 	wg.Wait()
 }
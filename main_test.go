@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	mode0660 := os.FileMode(0660)
+	uid1000 := 1000
+	gid1000 := 1000
+
+	cases := []struct {
+		name    string
+		addr    string
+		want    listenSpec
+		wantErr bool
+	}{
+		{name: "tcp scheme", addr: "tcp://localhost:8080", want: listenSpec{network: "tcp", address: "localhost:8080"}},
+		{name: "tls scheme", addr: "tls://localhost:8443", want: listenSpec{network: "tcp", address: "localhost:8443", tls: true}},
+		{name: "https scheme", addr: "https://localhost:8443", want: listenSpec{network: "tcp", address: "localhost:8443", tls: true}},
+		{name: "h2c scheme", addr: "h2c://localhost:8080", want: listenSpec{network: "tcp", address: "localhost:8080", h2c: true}},
+		{name: "fcgi scheme", addr: "fcgi://localhost:9000", want: listenSpec{network: "tcp", address: "localhost:9000", fcgi: true}},
+		{name: "proxy+tcp scheme", addr: "proxy+tcp://localhost:8080", want: listenSpec{network: "tcp", address: "localhost:8080", proxy: true}},
+		{name: "unix scheme", addr: "unix:///run/app.sock", want: listenSpec{network: "unix", address: "/run/app.sock"}},
+		{
+			name: "unix with mode/uid/gid query",
+			addr: "unix:///run/app.sock?mode=0660&uid=1000&gid=1000",
+			want: listenSpec{network: "unix", address: "/run/app.sock", unixMode: &mode0660, unixUID: &uid1000, unixGID: &gid1000},
+		},
+		{
+			name: "proxy+unix scheme",
+			addr: "proxy+unix:///run/app.sock",
+			want: listenSpec{network: "unix", address: "/run/app.sock", proxy: true},
+		},
+		{name: "unix missing path", addr: "unix://", wantErr: true},
+		{name: "unix invalid mode", addr: "unix:///run/app.sock?mode=zz", wantErr: true},
+		{name: "unix invalid uid", addr: "unix:///run/app.sock?uid=zz", wantErr: true},
+		{name: "unix invalid gid", addr: "unix:///run/app.sock?gid=zz", wantErr: true},
+		{name: "unsupported scheme", addr: "ftp://localhost:21", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseListenAddr(tc.addr)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseListenAddr(%q): expected error, got %+v", tc.addr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListenAddr(%q): unexpected error: %v", tc.addr, err)
+			}
+
+			if got.network != tc.want.network || got.address != tc.want.address ||
+				got.tls != tc.want.tls || got.h2c != tc.want.h2c || got.fcgi != tc.want.fcgi || got.proxy != tc.want.proxy {
+				t.Fatalf("parseListenAddr(%q) = %+v, want %+v", tc.addr, got, tc.want)
+			}
+			if !samePtr(got.unixMode, tc.want.unixMode) {
+				t.Fatalf("parseListenAddr(%q) unixMode = %v, want %v", tc.addr, got.unixMode, tc.want.unixMode)
+			}
+			if !samePtrInt(got.unixUID, tc.want.unixUID) {
+				t.Fatalf("parseListenAddr(%q) unixUID = %v, want %v", tc.addr, got.unixUID, tc.want.unixUID)
+			}
+			if !samePtrInt(got.unixGID, tc.want.unixGID) {
+				t.Fatalf("parseListenAddr(%q) unixGID = %v, want %v", tc.addr, got.unixGID, tc.want.unixGID)
+			}
+		})
+	}
+}
+
+func samePtr(a, b *os.FileMode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func samePtrInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,33 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	listenerAcceptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "listener_accepts_total",
+		Help: "Total connections accepted, by listener address.",
+	}, []string{"listener"})
+	listenerActiveConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "listener_active_connections",
+		Help: "Current number of active connections, by listener address.",
+	}, []string{"listener"})
+)
+
+func init() {
+	prometheus.MustRegister(listenerAcceptsTotal, listenerActiveConns)
+}
+
+// listenerMetrics tracks accept/active-connection counts for a single
+// listener, exposed through the metrics endpoint so operators can size
+// -max-conns and the timeout flags.
+type listenerMetrics struct {
+	accepted prometheus.Counter
+	active   prometheus.Gauge
+}
+
+func newListenerMetrics(addr string) *listenerMetrics {
+	return &listenerMetrics{
+		accepted: listenerAcceptsTotal.WithLabelValues(addr),
+		active:   listenerActiveConns.WithLabelValues(addr),
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "context"
+
+// PeerCred holds the credentials of the process on the other end of a
+// unix socket connection, as reported by SO_PEERCRED.
+type PeerCred struct {
+	UID uint32
+	GID uint32
+	PID int32
+}
+
+type peerCredKey struct{}
+
+// PeerCredFromContext returns the PeerCred recorded for the unix socket
+// connection a request arrived on, if any. Handlers can use this to
+// authorize local callers by uid/gid/pid on a unix:// listener.
+func PeerCredFromContext(ctx context.Context) (PeerCred, bool) {
+	pc, ok := ctx.Value(peerCredKey{}).(PeerCred)
+	return pc, ok
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// connContext is installed as http.Server.ConnContext. For unix socket
+// connections it reads SO_PEERCRED and stashes the result in the
+// request context for handlers to retrieve via PeerCredFromContext.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := unwrapUnixConn(c)
+	if !ok {
+		return ctx
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil || cred == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, peerCredKey{}, PeerCred{UID: cred.Uid, GID: cred.Gid, PID: cred.Pid})
+}
+
+// unwrapUnixConn walks through the listener wrapper conns (limitConn,
+// proxyConn, tls.Conn) that may sit between http.Server and the raw
+// connection, looking for a *net.UnixConn to read SO_PEERCRED from.
+// Without this, a unix:// listener behind -max-conns, proxy+unix://, or
+// a wrapper added in the future would always report no peer cred.
+func unwrapUnixConn(c net.Conn) (*net.UnixConn, bool) {
+	for {
+		switch v := c.(type) {
+		case *net.UnixConn:
+			return v, true
+		case interface{ NetConn() net.Conn }:
+			c = v.NetConn()
+		case interface{ RawConn() net.Conn }:
+			c = v.RawConn()
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestConnContextPeerCredThroughListenerChain drives a real unix://
+// listener through the same cfg.listeners() wrapping Accept uses in
+// production (limitListener, and proxyListener for proxy+unix://), to
+// make sure connContext can still find the *net.UnixConn underneath
+// and PeerCredFromContext reports our own credentials.
+func TestConnContextPeerCredThroughListenerChain(t *testing.T) {
+	cases := []struct {
+		name        string
+		scheme      string
+		proxyHeader bool
+	}{
+		{name: "unix", scheme: "unix"},
+		{name: "proxy+unix", scheme: "proxy+unix", proxyHeader: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sockPath := filepath.Join(t.TempDir(), "test.sock")
+			cfg := &config{addresses: []string{fmt.Sprintf("%s://%s", tc.scheme, sockPath)}, maxConns: 1}
+
+			listeners, err := cfg.listeners()
+			if err != nil {
+				t.Fatalf("cfg.listeners(): %v", err)
+			}
+			defer func() {
+				for _, l := range listeners {
+					_ = l.Close()
+				}
+			}()
+			if len(listeners) != 1 {
+				t.Fatalf("got %d listeners, want 1", len(listeners))
+			}
+			bl := listeners[0]
+
+			accepted := make(chan net.Conn, 1)
+			acceptErr := make(chan error, 1)
+			go func() {
+				c, err := bl.Accept()
+				if err != nil {
+					acceptErr <- err
+					return
+				}
+				accepted <- c
+			}()
+
+			client, err := net.Dial("unix", sockPath)
+			if err != nil {
+				t.Fatalf("dial %s: %v", sockPath, err)
+			}
+			defer client.Close()
+
+			if tc.proxyHeader {
+				if _, err := client.Write([]byte("PROXY UNKNOWN\r\n")); err != nil {
+					t.Fatalf("write proxy header: %v", err)
+				}
+			}
+
+			select {
+			case err := <-acceptErr:
+				t.Fatalf("Accept: %v", err)
+			case c := <-accepted:
+				defer c.Close()
+
+				ctx := connContext(context.Background(), c)
+				pc, ok := PeerCredFromContext(ctx)
+				if !ok {
+					t.Fatalf("PeerCredFromContext: ok=false, want true")
+				}
+				if pc.UID != uint32(os.Getuid()) {
+					t.Fatalf("PeerCred.UID = %d, want %d", pc.UID, os.Getuid())
+				}
+			}
+		})
+	}
+}
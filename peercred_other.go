@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"net"
+)
+
+// connContext is installed as http.Server.ConnContext. SO_PEERCRED is
+// Linux-specific, so on other platforms this leaves the context
+// unchanged and PeerCredFromContext always reports not-ok.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return ctx
+}
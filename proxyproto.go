@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyHeaderTimeout bounds how long Accept will wait for a connection
+// to send its PROXY protocol header before giving up on it; without a
+// deadline a client that opens a connection and never writes to it
+// would stall Accept, and therefore every other client on the listener,
+// forever.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Sig is the fixed 12-byte signature that opens a PROXY protocol
+// v2 header, distinguishing it from the plain-text v1 header.
+var proxyV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyListener wraps a net.Listener sitting behind an L4 load balancer
+// (e.g. HAProxy) that speaks the PROXY protocol: each accepted
+// connection is prefixed with a v1 (text) or v2 (binary) header naming
+// the true client address, which the returned proxyConn then reports
+// from RemoteAddr in place of the load balancer's own address.
+type proxyListener struct {
+	net.Listener
+}
+
+func newProxyListener(l net.Listener) net.Listener {
+	return &proxyListener{Listener: l}
+}
+
+// Accept blocks until it has a connection with a successfully parsed
+// PROXY header to hand back. A connection that is slow to send its
+// header or sends a malformed one is closed and skipped rather than
+// failed out of Accept: neither condition should be allowed to stall or
+// kill the shared accept loop net/http's Server.Serve runs.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); err != nil {
+			_ = c.Close()
+			continue
+		}
+
+		r := bufio.NewReader(c)
+		addr, err := readProxyHeader(r)
+		if err != nil {
+			_ = c.Close()
+			continue
+		}
+
+		if err := c.SetReadDeadline(time.Time{}); err != nil {
+			_ = c.Close()
+			continue
+		}
+
+		return &proxyConn{Conn: c, r: r, remoteAddr: addr}, nil
+	}
+}
+
+// proxyConn is a net.Conn whose leading bytes have already been
+// consumed by a bufio.Reader to parse the PROXY header; reads must go
+// through that reader to see the rest of the stream.
+type proxyConn struct {
+	net.Conn
+	r          *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// RawConn returns the conn proxyConn wraps, so callers that need the
+// concrete conn type underneath (e.g. connContext looking for a
+// *net.UnixConn to read SO_PEERCRED from) can unwrap past it.
+func (c *proxyConn) RawConn() net.Conn { return c.Conn }
+
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(proxyV2Sig))
+	if err == nil && bytes.Equal(peek, proxyV2Sig) {
+		return readProxyV2(r)
+	}
+	return readProxyV1(r)
+}
+
+// readProxyV1 parses a "PROXY TCP4 <src> <dst> <srcport> <dstport>\r\n"
+// or "PROXY UNKNOWN\r\n" text header.
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read v1 header: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid v1 source address %q", fields[2])
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses the binary v2 header: a 12-byte signature, one
+// version/command byte, one address-family/protocol byte, a 2-byte
+// payload length, then the address payload itself.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read v2 header: %w", err)
+	}
+
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version %d", header[12]>>4)
+	}
+	cmd := header[12] & 0x0F
+	family := header[13] >> 4
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("read v2 payload: %w", err)
+	}
+
+	if cmd == 0x0 {
+		// LOCAL command: a health check from the proxy itself, no
+		// meaningful source address.
+		return nil, nil
+	}
+
+	switch family {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("short v2 IPv4 payload")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}, nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("short v2 IPv6 payload")
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyV1(t *testing.T) {
+	cases := []struct {
+		name     string
+		line     string
+		wantAddr string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "tcp4", line: "PROXY TCP4 192.168.1.1 192.168.1.2 56324 443\r\n", wantAddr: "192.168.1.1:56324"},
+		{name: "unknown", line: "PROXY UNKNOWN\r\n", wantNil: true},
+		{name: "wrong prefix", line: "GET / HTTP/1.1\r\n", wantErr: true},
+		{name: "too few fields", line: "PROXY TCP4 192.168.1.1\r\n", wantErr: true},
+		{name: "bad ip", line: "PROXY TCP4 not-an-ip 192.168.1.2 56324 443\r\n", wantErr: true},
+		{name: "bad port", line: "PROXY TCP4 192.168.1.1 192.168.1.2 notaport 443\r\n", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := readProxyV1(bufio.NewReader(strings.NewReader(tc.line)))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("readProxyV1(%q): expected error, got %v", tc.line, addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyV1(%q): unexpected error: %v", tc.line, err)
+			}
+			if tc.wantNil {
+				if addr != nil {
+					t.Fatalf("readProxyV1(%q) = %v, want nil", tc.line, addr)
+				}
+				return
+			}
+			if addr == nil || addr.String() != tc.wantAddr {
+				t.Fatalf("readProxyV1(%q) = %v, want %s", tc.line, addr, tc.wantAddr)
+			}
+		})
+	}
+}
+
+func buildProxyV2(t *testing.T, cmd, family byte, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(proxyV2Sig)
+	buf.WriteByte(0x20 | cmd)
+	buf.WriteByte(family << 4)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(payload)))
+	buf.Write(length)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestReadProxyV2(t *testing.T) {
+	t.Run("ipv4", func(t *testing.T) {
+		payload := make([]byte, 12)
+		copy(payload[0:4], net.ParseIP("10.0.0.1").To4())
+		copy(payload[4:8], net.ParseIP("10.0.0.2").To4())
+		binary.BigEndian.PutUint16(payload[8:10], 12345)
+		binary.BigEndian.PutUint16(payload[10:12], 443)
+
+		data := buildProxyV2(t, 0x1, 0x1, payload)
+		addr, err := readProxyV2(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("readProxyV2: unexpected error: %v", err)
+		}
+		if addr == nil || addr.String() != "10.0.0.1:12345" {
+			t.Fatalf("readProxyV2 = %v, want 10.0.0.1:12345", addr)
+		}
+	})
+
+	t.Run("local command has no address", func(t *testing.T) {
+		data := buildProxyV2(t, 0x0, 0x1, nil)
+		addr, err := readProxyV2(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("readProxyV2: unexpected error: %v", err)
+		}
+		if addr != nil {
+			t.Fatalf("readProxyV2 = %v, want nil", addr)
+		}
+	})
+
+	t.Run("short ipv4 payload", func(t *testing.T) {
+		data := buildProxyV2(t, 0x1, 0x1, []byte{1, 2, 3})
+		if _, err := readProxyV2(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			t.Fatal("readProxyV2: expected error for short payload")
+		}
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		data := buildProxyV2(t, 0x1, 0x1, make([]byte, 12))
+		data[12] = 0x10 | 0x1 // version 1, not 2
+		if _, err := readProxyV2(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			t.Fatal("readProxyV2: expected error for unsupported version")
+		}
+	})
+}
+
+func TestReadProxyHeaderDispatch(t *testing.T) {
+	t.Run("v1 text header", func(t *testing.T) {
+		addr, err := readProxyHeader(bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\n")))
+		if err != nil || addr != nil {
+			t.Fatalf("readProxyHeader(v1) = %v, %v, want nil, nil", addr, err)
+		}
+	})
+
+	t.Run("v2 binary header", func(t *testing.T) {
+		data := buildProxyV2(t, 0x0, 0x1, nil)
+		addr, err := readProxyHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil || addr != nil {
+			t.Fatalf("readProxyHeader(v2) = %v, %v, want nil, nil", addr, err)
+		}
+	})
+}
+
+func TestProxyListenerAcceptSkipsMalformedConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	pl := newProxyListener(ln)
+
+	bad, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial bad: %v", err)
+	}
+	if _, err := bad.Write([]byte("this is not a proxy header at all\r\n")); err != nil {
+		t.Fatalf("write bad header: %v", err)
+	}
+
+	good, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial good: %v", err)
+	}
+	if _, err := good.Write([]byte("PROXY TCP4 10.0.0.1 10.0.0.2 1111 443\r\nhello\n")); err != nil {
+		t.Fatalf("write good header: %v", err)
+	}
+
+	c, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("Accept: expected the malformed connection to be skipped, got error: %v", err)
+	}
+	defer c.Close()
+
+	if got := c.RemoteAddr().String(); got != "10.0.0.1:1111" {
+		t.Fatalf("Accept() remote addr = %q, want 10.0.0.1:1111", got)
+	}
+
+	bad.Close()
+	good.Close()
+}
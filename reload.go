@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// reloadFDs dup2's each listener's underlying file descriptor onto the
+// consecutive LISTEN_FDS range starting at listenFdsStart and clears
+// FD_CLOEXEC on the copies, so they survive the syscall.Exec performed
+// by execSelf. It must be called before srv.Shutdown, since Shutdown
+// closes the original listeners.
+func reloadFDs(listeners []boundListener) (int, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+
+	for i, l := range listeners {
+		f, ok := l.Listener.(filer)
+		if !ok {
+			return 0, fmt.Errorf("listener %s does not support file extraction", l.Addr())
+		}
+		file, err := f.File()
+		if err != nil {
+			return 0, fmt.Errorf("listener %s: %w", l.Addr(), err)
+		}
+
+		fd := listenFdsStart + i
+		dupErr := syscall.Dup2(int(file.Fd()), fd)
+		file.Close()
+		if dupErr != nil {
+			return 0, fmt.Errorf("dup listener fd to %d: %w", fd, dupErr)
+		}
+		syscall.CloseOnExec(fd)
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+			return 0, fmt.Errorf("clear FD_CLOEXEC on fd %d: %w", fd, errno)
+		}
+	}
+
+	return len(listeners), nil
+}
+
+// execSelf re-execs the running binary with LISTEN_PID/LISTEN_FDS/
+// LISTEN_FDNAMES set so the new process picks up the n listener fds
+// already placed at listenFdsStart by reloadFDs. It does not return on
+// success.
+func execSelf(n int, names []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("resolve executable: %w", err)
+	}
+
+	env := append(os.Environ(),
+		"LISTEN_PID="+strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS="+strconv.Itoa(n),
+	)
+	if len(names) > 0 {
+		env = append(env, "LISTEN_FDNAMES="+strings.Join(names, ":"))
+	}
+
+	if err := syscall.Exec(exe, os.Args, env); err != nil {
+		return fmt.Errorf("exec %s: %w", exe, err)
+	}
+	return nil
+}
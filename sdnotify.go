@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a message to the systemd notification socket named by
+// $NOTIFY_SOCKET, if set. It is a no-op returning nil when the process
+// is not running under systemd with notifications enabled, which lets
+// callers invoke it unconditionally. See sd_notify(3).
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval reports how often WATCHDOG=1 keepalive pings should
+// be sent, derived from $WATCHDOG_USEC and $WATCHDOG_PID per
+// sd_watchdog_enabled(3). It returns false if the watchdog is not
+// enabled for this process.
+func watchdogInterval() (time.Duration, bool) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" {
+		if p, err := strconv.Atoi(pid); err == nil && p != os.Getpid() {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	// Ping at half the enforced interval, as recommended by sd_watchdog_enabled(3).
+	return time.Duration(n) * time.Microsecond / 2, true
+}
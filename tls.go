@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsConfig builds the *tls.Config shared by all tls:// and https://
+// listeners, loading the server certificate/key and, when -tls-client-ca
+// is set, a CA bundle used to require and verify client certificates.
+func (c *config) tlsConfig() (*tls.Config, error) {
+	if c.tlsCert == "" || c.tlsKey == "" {
+		return nil, fmt.Errorf("-tls-cert and -tls-key are required to listen on a tls:// or https:// address")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	minVersion, err := parseTLSVersion(c.tlsMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		// NextProtos advertises h2 over ALPN so TLS listeners actually
+		// negotiate HTTP/2 with http2.ConfigureServer instead of
+		// silently falling back to HTTP/1.1 on every connection.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if c.tlsClientCA != "" {
+		pem, err := os.ReadFile(c.tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read -tls-client-ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in -tls-client-ca %s", c.tlsClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("invalid -tls-min-version %q (want one of 1.0, 1.1, 1.2, 1.3)", v)
+	}
+}
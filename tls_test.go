@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    uint16
+		wantErr bool
+	}{
+		{in: "", want: tls.VersionTLS12},
+		{in: "1.2", want: tls.VersionTLS12},
+		{in: "1.3", want: tls.VersionTLS13},
+		{in: "1.1", want: tls.VersionTLS11},
+		{in: "1.0", want: tls.VersionTLS10},
+		{in: "1.4", wantErr: true},
+		{in: "garbage", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		got, err := parseTLSVersion(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseTLSVersion(%q): expected error, got %v", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTLSVersion(%q): unexpected error: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseTLSVersion(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+)
+
+// tlsListener wraps tls.NewListener's result while keeping a reference
+// to the pre-TLS listener it was built from. tls.Listener has no File
+// method, so without this a tls:// or https:// listener would fail the
+// filer assertion in reloadFDs and silently break the SIGHUP re-exec for
+// the whole process.
+type tlsListener struct {
+	net.Listener
+	raw net.Listener
+}
+
+func newTLSListener(raw net.Listener, cfg *tls.Config) net.Listener {
+	return &tlsListener{Listener: tls.NewListener(raw, cfg), raw: raw}
+}
+
+// File delegates to the pre-TLS listener's File method, so a tlsListener
+// still satisfies the filer interface reload.go uses to extract fds for
+// a SIGHUP re-exec.
+func (l *tlsListener) File() (*os.File, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+	f, ok := l.raw.(filer)
+	if !ok {
+		return nil, fmt.Errorf("listener %s does not support file extraction", l.Addr())
+	}
+	return f.File()
+}